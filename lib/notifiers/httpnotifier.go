@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPNotifier POSTs (or otherwise sends) an already-templated body to an
+// arbitrary webhook URL. It factors out the plain webhook-posting mechanics
+// that a chat-specific binary (Slack, Discord, MS Teams, Google Chat, a
+// generic webhook, ...) would otherwise have to hand-roll, so that binary
+// can focus on its own payload shape and reuse this for any destination that
+// just wants a templated JSON or form body over HTTP.
+type HTTPNotifier struct {
+	// URL is the webhook endpoint to send to.
+	URL string
+	// Method defaults to http.MethodPost if empty.
+	Method string
+	// ContentType is set as the Content-Type header if non-empty.
+	ContentType string
+	// Headers are additional headers applied to every request.
+	Headers map[string]string
+	// Client defaults to http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Send sends body to n.URL using n.Method, returning an error if the request
+// can't be built or sent, or if the response status is >= 300.
+func (n *HTTPNotifier) Send(ctx context.Context, body []byte) error {
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	method := n.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build HTTP request: %w", err)
+	}
+	if n.ContentType != "" {
+		req.Header.Set("Content-Type", n.ContentType)
+	}
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
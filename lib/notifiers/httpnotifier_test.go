@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPNotifierSend(t *testing.T) {
+	var gotMethod, gotContentType, gotHeader, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotContentType = r.Header.Get("Content-Type")
+		gotHeader = r.Header.Get("X-Custom")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	n := &HTTPNotifier{
+		URL:         srv.URL,
+		Method:      http.MethodPut,
+		ContentType: "application/x-mattermost",
+		Headers:     map[string]string{"X-Custom": "yes"},
+	}
+
+	if err := n.Send(context.Background(), []byte(`{"text":"hi"}`)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if gotMethod != http.MethodPut {
+		t.Errorf("method = %q, want %q", gotMethod, http.MethodPut)
+	}
+	if gotContentType != "application/x-mattermost" {
+		t.Errorf("Content-Type = %q, want %q", gotContentType, "application/x-mattermost")
+	}
+	if gotHeader != "yes" {
+		t.Errorf("X-Custom header = %q, want %q", gotHeader, "yes")
+	}
+	if gotBody != `{"text":"hi"}` {
+		t.Errorf("body = %q, want %q", gotBody, `{"text":"hi"}`)
+	}
+}
+
+func TestHTTPNotifierSendDefaultsMethod(t *testing.T) {
+	var gotMethod string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	n := &HTTPNotifier{URL: srv.URL}
+	if err := n.Send(context.Background(), []byte(`{}`)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if gotMethod != http.MethodPost {
+		t.Errorf("method = %q, want %q (default)", gotMethod, http.MethodPost)
+	}
+}
+
+func TestHTTPNotifierSendErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("nope"))
+	}))
+	defer srv.Close()
+
+	n := &HTTPNotifier{URL: srv.URL}
+	if err := n.Send(context.Background(), []byte(`{}`)); err == nil {
+		t.Fatal("Send with a 400 response returned nil error, want non-nil")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import "context"
+
+// MentionResolver resolves a Git identity (typically a commit author's
+// email address) to whatever identifier a chat backend needs to @-mention
+// that person (e.g. a Slack user ID). It's deliberately backend-agnostic so
+// any notifier binary can share the same resolution strategy instead of
+// reimplementing mapping-file loading and directory-lookup fallback.
+type MentionResolver interface {
+	// Resolve returns the backend-specific mention identifier for email,
+	// and false if email is empty or couldn't be resolved.
+	Resolve(ctx context.Context, email string) (id string, ok bool, err error)
+}
+
+// StaticMentionResolver resolves emails against a fixed map, typically
+// loaded once at notifier SetUp time from a Secret or a GCS object. Emails
+// missing from ByEmail fall back to Fallback, if set, so callers can layer a
+// live directory lookup (e.g. Slack's users.lookupByEmail) on top of the
+// static mapping.
+type StaticMentionResolver struct {
+	ByEmail  map[string]string
+	Fallback func(ctx context.Context, email string) (id string, ok bool, err error)
+}
+
+// Resolve implements MentionResolver.
+func (r *StaticMentionResolver) Resolve(ctx context.Context, email string) (string, bool, error) {
+	if email == "" {
+		return "", false, nil
+	}
+	if id, ok := r.ByEmail[email]; ok {
+		return id, true, nil
+	}
+	if r.Fallback != nil {
+		return r.Fallback(ctx, email)
+	}
+	return "", false, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStaticMentionResolverResolvesFromMap(t *testing.T) {
+	r := &StaticMentionResolver{ByEmail: map[string]string{"dev@example.com": "U123"}}
+
+	id, ok, err := r.Resolve(context.Background(), "dev@example.com")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !ok || id != "U123" {
+		t.Errorf("Resolve(mapped) = (%q, %v), want (\"U123\", true)", id, ok)
+	}
+}
+
+func TestStaticMentionResolverEmptyEmail(t *testing.T) {
+	r := &StaticMentionResolver{ByEmail: map[string]string{"dev@example.com": "U123"}}
+
+	if _, ok, err := r.Resolve(context.Background(), ""); err != nil || ok {
+		t.Errorf("Resolve(\"\") = (_, %v, %v), want (_, false, nil)", ok, err)
+	}
+}
+
+func TestStaticMentionResolverFallback(t *testing.T) {
+	called := false
+	r := &StaticMentionResolver{
+		ByEmail: map[string]string{},
+		Fallback: func(ctx context.Context, email string) (string, bool, error) {
+			called = true
+			if email == "unknown@example.com" {
+				return "U999", true, nil
+			}
+			return "", false, nil
+		},
+	}
+
+	id, ok, err := r.Resolve(context.Background(), "unknown@example.com")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !called {
+		t.Error("Fallback was not called for an unmapped email")
+	}
+	if !ok || id != "U999" {
+		t.Errorf("Resolve(fallback) = (%q, %v), want (\"U999\", true)", id, ok)
+	}
+}
+
+func TestStaticMentionResolverNoFallback(t *testing.T) {
+	r := &StaticMentionResolver{ByEmail: map[string]string{}}
+
+	if _, ok, err := r.Resolve(context.Background(), "unknown@example.com"); err != nil || ok {
+		t.Errorf("Resolve(no fallback) = (_, %v, %v), want (_, false, nil)", ok, err)
+	}
+}
+
+func TestStaticMentionResolverFallbackError(t *testing.T) {
+	wantErr := errors.New("lookup failed")
+	r := &StaticMentionResolver{
+		ByEmail: map[string]string{},
+		Fallback: func(ctx context.Context, email string) (string, bool, error) {
+			return "", false, wantErr
+		},
+	}
+
+	_, _, err := r.Resolve(context.Background(), "unknown@example.com")
+	if !errors.Is(err, wantErr) {
+		t.Errorf("Resolve error = %v, want %v", err, wantErr)
+	}
+}
@@ -16,22 +16,155 @@ package main
 
 import (
 	"bytes"
+	"container/list"
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
+	cloudbuild "cloud.google.com/go/cloudbuild/apiv1/v2"
 	cbpb "cloud.google.com/go/cloudbuild/apiv1/v2/cloudbuildpb"
+	"cloud.google.com/go/logging/logadmin"
 	"github.com/GoogleCloudPlatform/cloud-build-notifiers/lib/notifiers"
 	log "github.com/golang/glog"
 	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+	"google.golang.org/api/iterator"
 )
 
 const (
-	webhookURLSecretName = "webhookUrl"
+	webhookURLSecretName  = "webhookUrl"
+	botTokenSecretName    = "botToken"
+	mentionsMapSecretName = "mentionsMap"
+	appTokenSecretName    = "appToken"
+
+	retryBuildActionID   = "retry_build"
+	cancelBuildActionID  = "cancel_build"
+	approveBuildActionID = "approve_manual_step"
+
+	// maxBlockTextLen is comfortably under Slack's 3000-char limit on a
+	// single text object, leaving room for the surrounding mrkdwn markup a
+	// template wraps the log tail in.
+	maxBlockTextLen = 2900
 )
 
+// defaultThreadStoreSize bounds the number of distinct thread keys an
+// in-memory threadStore remembers at once, so a long-running deployment
+// keyed on high-cardinality values (commit SHA, PR number, ...) doesn't
+// grow without bound for the life of the process.
+const defaultThreadStoreSize = 10000
+
+// threadStore maps a rendered thread key (e.g. a commit SHA or PR number) to
+// the Slack message timestamp of the first message posted for that key, so
+// that later notifications for the same key can be threaded underneath it.
+// It evicts the least-recently-used key once more than maxSize keys are
+// held.
+//
+// This is an in-memory, best-effort store: it does not survive notifier
+// restarts. Deployments that need durability across restarts should look to
+// a notifiers.StateStore-backed implementation instead.
+type threadStore struct {
+	mu      sync.Mutex
+	maxSize int
+	order   *list.List               // of *threadEntry, most-recently-used at the front
+	entries map[string]*list.Element // key -> its element in order
+
+	keyMu sync.Mutex
+	locks map[string]*keyLock
+}
+
+type threadEntry struct {
+	key string
+	ts  string
+}
+
+// keyLock is a per-key mutex that tracks how many callers currently hold or
+// are waiting on it, so it can be removed from threadStore.locks the instant
+// it's no longer in use rather than only when the LRU happens to evict that
+// key.
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newThreadStore(maxSize int) *threadStore {
+	if maxSize <= 0 {
+		maxSize = defaultThreadStoreSize
+	}
+	return &threadStore{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		locks:   map[string]*keyLock{},
+	}
+}
+
+func (s *threadStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return "", false
+	}
+	s.order.MoveToFront(el)
+	return el.Value.(*threadEntry).ts, true
+}
+
+func (s *threadStore) Set(key, ts string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*threadEntry).ts = ts
+		s.order.MoveToFront(el)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&threadEntry{key: key, ts: ts})
+	if s.order.Len() > s.maxSize {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*threadEntry).key)
+	}
+}
+
+// Lock returns an unlock function that serializes all callers operating on
+// key, so a caller can perform an atomic get-or-reserve sequence (check for
+// an existing thread, post or update in Slack, then record the result)
+// without a second notification for the same key racing in between. Locks
+// for distinct keys are independent and don't block each other.
+//
+// The per-key lock is reference-counted and removed from s.locks as soon as
+// its last holder unlocks, rather than waiting for the key to scroll out of
+// the LRU (which would never happen for a key whose Set never runs, e.g.
+// because the Slack call in between failed) and rather than trying to evict
+// it opportunistically while other callers might still be waiting on it.
+func (s *threadStore) Lock(key string) func() {
+	s.keyMu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &keyLock{}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.keyMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.keyMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, key)
+		}
+		s.keyMu.Unlock()
+	}
+}
+
 func main() {
 	if err := notifiers.Main(new(slackNotifier)); err != nil {
 		log.Fatalf("fatal error: %v", err)
@@ -45,6 +178,115 @@ type slackNotifier struct {
 	webhookURL string
 	br         notifiers.BindingResolver
 	tmplView   *notifiers.TemplateView
+
+	// Optional bot-token based threading support. botToken and channel are
+	// only set when the delivery config provides a "botToken" secret; when
+	// unset, notifications fall back to the plain incoming-webhook path.
+	botToken      string
+	channel       string
+	threadKeyTmpl *template.Template
+	updateInPlace bool
+	threads       *threadStore
+	slackClient   *slack.Client
+
+	// Optional per-message sending identity overrides, rendered as Go
+	// templates from cfg.Spec.Notification.Params. A Block Kit template can
+	// also set these by emitting top-level "username"/"icon_emoji"/"icon_url"
+	// keys alongside "blocks"; those take precedence when present.
+	usernameTmpl  *template.Template
+	iconEmojiTmpl *template.Template
+	iconURLTmpl   *template.Template
+
+	// Optional @-mention resolution, used by the mentionByEmail,
+	// mentionByCommitAuthor, and mentionChannelOnBranch template funcs.
+	// mentionResolver is built once at SetUp time from a "mentionsMap"
+	// secret holding a JSON object of Git email -> Slack user ID; any email
+	// missing from that mapping falls back to a live users.lookupByEmail
+	// call when a bot token is configured. mentionFilter gates when mentions
+	// are allowed to fire at all (default: FAILURE/TIMEOUT/INTERNAL_ERROR).
+	mentionResolver notifiers.MentionResolver
+	mentionFilter   notifiers.EventFilter
+
+	// Optional generic-webhook mode: when rawBody is true, the templated
+	// output is sent to webhookURL verbatim via httpNotifier (with the
+	// configured method, headers, and content type) instead of being parsed
+	// as Slack Block Kit and sent via slack.PostWebhook. This lets the same
+	// binary and CEL filtering target non-Slack destinations (Discord, MS
+	// Teams, Google Chat, ...) that accept a templated JSON or form body.
+	rawBody      bool
+	httpNotifier *notifiers.HTTPNotifier
+
+	// Optional interactive mode: when params.interactive is "true", SetUp
+	// opens a Slack Socket Mode connection (in addition to the normal
+	// one-way notification path above) so that on-call engineers can act on
+	// build-action buttons (retry_build/cancel_build/approve_manual_step)
+	// emitted by a template, without leaving Slack. Requires both a
+	// "botToken" and an "appToken" (xapp-...) secret. cbClient is the
+	// buildActioner seam handleBlockAction dispatches through, so tests can
+	// swap in a fake instead of hitting real Cloud Build.
+	cbClient buildActioner
+
+	// Optional log-tail attachment: when logTailLines > 0, SendNotification
+	// fetches the last logTailLines lines of the build's log from Cloud
+	// Logging for FAILURE/INTERNAL_ERROR/TIMEOUT builds and exposes them to
+	// templates as Params["LogTail"], i.e. a template must write
+	// "{{.Params.LogTail}}", not "{{.LogTail}}" — notifiers.TemplateView has
+	// no dedicated field for it, so it rides along with the other template
+	// bindings and would silently render empty if a user's own CEL/binding
+	// config happens to set its own "LogTail" key (this one takes
+	// precedence, since it's set last in SendNotification). logFetchers
+	// caches one logTailFetcher per project, since a logadmin.Client is
+	// scoped to a single GCP project.
+	logTailLines  int
+	logFetchers   map[string]logTailFetcher
+	logFetchersMu sync.Mutex
+}
+
+// logTailEntry mirrors the single field of *logging.Entry fetchLogTail
+// reads, so fetchLogTail and its tests don't need to depend on Cloud
+// Logging's wire types.
+type logTailEntry struct {
+	Payload interface{}
+}
+
+// logTailIterator is the subset of *logadmin.EntryIterator's API
+// fetchLogTail depends on.
+type logTailIterator interface {
+	Next() (*logTailEntry, error)
+}
+
+// logTailFetcher is the subset of Cloud Logging's API fetchLogTail depends
+// on, implemented by *cloudLoggingFetcher against the real service and by a
+// fake in tests, so the filter string, the newest-first-to-chronological
+// reordering, and the logTailLines cutoff can all be verified without
+// hitting real Cloud Logging.
+type logTailFetcher interface {
+	FetchEntries(ctx context.Context, project, buildID string) logTailIterator
+}
+
+// cloudLoggingFetcher adapts a *logadmin.Client to logTailFetcher.
+type cloudLoggingFetcher struct {
+	client *logadmin.Client
+}
+
+func (f *cloudLoggingFetcher) FetchEntries(ctx context.Context, project, buildID string) logTailIterator {
+	it := f.client.Entries(ctx,
+		logadmin.Filter(fmt.Sprintf(`resource.type="build" AND resource.labels.build_id=%q`, buildID)),
+		logadmin.NewestFirst())
+	return &cloudLoggingIterator{it: it}
+}
+
+// cloudLoggingIterator adapts a *logadmin.EntryIterator to logTailIterator.
+type cloudLoggingIterator struct {
+	it *logadmin.EntryIterator
+}
+
+func (i *cloudLoggingIterator) Next() (*logTailEntry, error) {
+	entry, err := i.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	return &logTailEntry{Payload: entry.Payload}, nil
 }
 
 func (s *slackNotifier) SetUp(ctx context.Context, cfg *notifiers.Config, blockKitTemplate string, sg notifiers.SecretGetter, br notifiers.BindingResolver) error {
@@ -81,6 +323,10 @@ func (s *slackNotifier) SetUp(ctx context.Context, cfg *notifiers.Config, blockK
 			// Remove surrounding quotes from json.Marshal result
 			return string(b[1 : len(b)-1])
 		},
+		"mentionByEmail":         s.mentionByEmail,
+		"mentionByCommitAuthor":  s.mentionByCommitAuthor,
+		"mentionChannelOnBranch": s.mentionChannelOnBranch,
+		"truncate":               truncate,
 	}).Parse(blockKitTemplate)
 	if err != nil {
 		return fmt.Errorf("failed to parse blockkit template: %w", err)
@@ -95,6 +341,10 @@ func (s *slackNotifier) SetUp(ctx context.Context, cfg *notifiers.Config, blockK
 			"replace": func(s, old, new string) string {
 				return strings.ReplaceAll(s, old, new)
 			},
+			"mentionByEmail":         s.mentionByEmail,
+			"mentionByCommitAuthor":  s.mentionByCommitAuthor,
+			"mentionChannelOnBranch": s.mentionChannelOnBranch,
+			"truncate":               truncate,
 		}).Parse(messageTemplate)
 		if err != nil {
 			return fmt.Errorf("failed to parse message template: %w", err)
@@ -102,9 +352,332 @@ func (s *slackNotifier) SetUp(ctx context.Context, cfg *notifiers.Config, blockK
 		s.textTmpl = messageTemplateTmpl
 	}
 
+	// A "botToken" secret opts the notifier into the bot-token path, which is
+	// required for thread grouping since incoming webhooks cannot return or
+	// target a message timestamp.
+	if btRef, err := notifiers.GetSecretRef(cfg.Spec.Notification.Delivery, botTokenSecretName); err == nil {
+		btResource, err := notifiers.FindSecretResourceName(cfg.Spec.Secrets, btRef)
+		if err != nil {
+			return fmt.Errorf("failed to find Secret for ref %q: %w", btRef, err)
+		}
+		bt, err := sg.GetSecret(ctx, btResource)
+		if err != nil {
+			return fmt.Errorf("failed to get bot token secret: %w", err)
+		}
+		s.botToken = bt
+		s.slackClient = slack.New(bt)
+
+		threadStoreSize := defaultThreadStoreSize
+		if sizeParam, ok := cfg.Spec.Notification.Params["threadStoreSize"]; ok && sizeParam != "" {
+			n, err := strconv.Atoi(sizeParam)
+			if err != nil {
+				return fmt.Errorf("failed to parse threadStoreSize %q as an int: %w", sizeParam, err)
+			}
+			threadStoreSize = n
+		}
+		s.threads = newThreadStore(threadStoreSize)
+	}
+
+	s.channel = cfg.Spec.Notification.Params["channel"]
+	s.updateInPlace = cfg.Spec.Notification.Params["update_in_place"] == "true"
+
+	if threadKey, ok := cfg.Spec.Notification.Params["threadKey"]; ok && threadKey != "" {
+		if s.botToken == "" {
+			return fmt.Errorf("threadKey was set but no %q secret was configured in the delivery config", botTokenSecretName)
+		}
+		threadKeyTmpl, err := template.New("thread_key_template").Parse(threadKey)
+		if err != nil {
+			return fmt.Errorf("failed to parse threadKey template: %w", err)
+		}
+		s.threadKeyTmpl = threadKeyTmpl
+	}
+
+	identityTmpl, err := parseIdentityParam(cfg.Spec.Notification.Params, "username")
+	if err != nil {
+		return err
+	}
+	s.usernameTmpl = identityTmpl
+
+	if identityTmpl, err = parseIdentityParam(cfg.Spec.Notification.Params, "icon_emoji"); err != nil {
+		return err
+	}
+	s.iconEmojiTmpl = identityTmpl
+
+	if identityTmpl, err = parseIdentityParam(cfg.Spec.Notification.Params, "icon_url"); err != nil {
+		return err
+	}
+	s.iconURLTmpl = identityTmpl
+
+	staticMentions := &notifiers.StaticMentionResolver{Fallback: s.lookupMentionByEmail}
+	if mmRef, err := notifiers.GetSecretRef(cfg.Spec.Notification.Delivery, mentionsMapSecretName); err == nil {
+		mmResource, err := notifiers.FindSecretResourceName(cfg.Spec.Secrets, mmRef)
+		if err != nil {
+			return fmt.Errorf("failed to find Secret for ref %q: %w", mmRef, err)
+		}
+		mm, err := sg.GetSecret(ctx, mmResource)
+		if err != nil {
+			return fmt.Errorf("failed to get mentions map secret: %w", err)
+		}
+		if err := json.Unmarshal([]byte(mm), &staticMentions.ByEmail); err != nil {
+			return fmt.Errorf("failed to parse mentions map secret as a JSON object of email to Slack user ID: %w", err)
+		}
+	}
+	s.mentionResolver = staticMentions
+
+	if mentionFilter, ok := cfg.Spec.Notification.Params["mentionFilter"]; ok && mentionFilter != "" {
+		prd, err := notifiers.MakeCELPredicate(mentionFilter)
+		if err != nil {
+			return fmt.Errorf("failed to make a CEL predicate for mentionFilter: %w", err)
+		}
+		s.mentionFilter = prd
+	}
+
+	s.rawBody = cfg.Spec.Notification.Params["rawBody"] == "true"
+	if s.rawBody {
+		hn := &notifiers.HTTPNotifier{URL: s.webhookURL, Method: http.MethodPost, ContentType: "application/json"}
+		if m, ok := cfg.Spec.Notification.Params["httpMethod"]; ok && m != "" {
+			hn.Method = m
+		}
+		if ct, ok := cfg.Spec.Notification.Params["contentType"]; ok && ct != "" {
+			hn.ContentType = ct
+		}
+		if hdrs, ok := cfg.Spec.Notification.Params["httpHeaders"]; ok && hdrs != "" {
+			if err := json.Unmarshal([]byte(hdrs), &hn.Headers); err != nil {
+				return fmt.Errorf("failed to parse httpHeaders param as a JSON object of header name to value: %w", err)
+			}
+		}
+		s.httpNotifier = hn
+	}
+
+	if cfg.Spec.Notification.Params["interactive"] == "true" {
+		if err := s.setUpInteractive(ctx, cfg, sg); err != nil {
+			return fmt.Errorf("failed to set up interactive mode: %w", err)
+		}
+	}
+
+	if lines, ok := cfg.Spec.Notification.Params["logTailLines"]; ok && lines != "" {
+		n, err := strconv.Atoi(lines)
+		if err != nil {
+			return fmt.Errorf("failed to parse logTailLines %q as an int: %w", lines, err)
+		}
+		s.logTailLines = n
+		s.logFetchers = map[string]logTailFetcher{}
+	}
+
+	return nil
+}
+
+// setUpInteractive opens a Slack Socket Mode connection and starts a
+// goroutine to service build-action button clicks for the lifetime of the
+// notifier process.
+func (s *slackNotifier) setUpInteractive(ctx context.Context, cfg *notifiers.Config, sg notifiers.SecretGetter) error {
+	if s.botToken == "" {
+		return fmt.Errorf("interactive mode requires a %q secret", botTokenSecretName)
+	}
+
+	atRef, err := notifiers.GetSecretRef(cfg.Spec.Notification.Delivery, appTokenSecretName)
+	if err != nil {
+		return fmt.Errorf("failed to get Secret ref for %q: %w", appTokenSecretName, err)
+	}
+	atResource, err := notifiers.FindSecretResourceName(cfg.Spec.Secrets, atRef)
+	if err != nil {
+		return fmt.Errorf("failed to find Secret for ref %q: %w", atRef, err)
+	}
+	at, err := sg.GetSecret(ctx, atResource)
+	if err != nil {
+		return fmt.Errorf("failed to get app token secret: %w", err)
+	}
+
+	cbClient, err := cloudbuild.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Cloud Build client: %w", err)
+	}
+	s.cbClient = &cloudBuildActioner{client: cbClient}
+
+	client := slack.New(s.botToken, slack.OptionAppLevelToken(at))
+	s.slackClient = client
+	sm := socketmode.New(client)
+
+	go func() {
+		for evt := range sm.Events {
+			if evt.Type != socketmode.EventTypeInteractive {
+				continue
+			}
+			callback, ok := evt.Data.(slack.InteractionCallback)
+			if !ok {
+				continue
+			}
+			sm.Ack(*evt.Request)
+			for _, action := range callback.ActionCallback.BlockActions {
+				if err := s.handleBlockAction(context.Background(), action); err != nil {
+					log.Errorf("failed to handle Slack block action %q: %v", action.ActionID, err)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		if err := sm.RunContext(ctx); err != nil {
+			log.Errorf("Slack Socket Mode connection ended: %v", err)
+		}
+	}()
+
 	return nil
 }
 
+// buildActioner is the subset of the Cloud Build API handleBlockAction
+// depends on, implemented by *cloudBuildActioner against the real service
+// and by a fake in tests so the action_id -> API-call dispatch below can be
+// verified without touching production Cloud Build.
+type buildActioner interface {
+	RetryBuild(ctx context.Context, project, buildID string) error
+	CancelBuild(ctx context.Context, project, buildID string) error
+	ApproveBuild(ctx context.Context, project, buildID string) error
+}
+
+// cloudBuildActioner adapts a *cloudbuild.Client to buildActioner, building
+// the request protos the real API expects from handleBlockAction's plain
+// (project, buildID) inputs.
+type cloudBuildActioner struct {
+	client *cloudbuild.Client
+}
+
+func (a *cloudBuildActioner) RetryBuild(ctx context.Context, project, buildID string) error {
+	_, err := a.client.RetryBuild(ctx, &cbpb.RetryBuildRequest{ProjectId: project, Id: buildID})
+	return err
+}
+
+func (a *cloudBuildActioner) CancelBuild(ctx context.Context, project, buildID string) error {
+	_, err := a.client.CancelBuild(ctx, &cbpb.CancelBuildRequest{ProjectId: project, Id: buildID})
+	return err
+}
+
+func (a *cloudBuildActioner) ApproveBuild(ctx context.Context, project, buildID string) error {
+	_, err := a.client.ApproveBuild(ctx, &cbpb.ApproveBuildRequest{
+		Name: fmt.Sprintf("projects/%s/builds/%s", project, buildID),
+		ApprovalResult: &cbpb.ApprovalResult{
+			Decision: cbpb.ApprovalResult_APPROVED,
+		},
+	})
+	return err
+}
+
+// handleBlockAction maps a build-action button click to the corresponding
+// Cloud Build API call. Buttons are expected to encode the target build as
+// "<project_id>/<build_id>" in their Value field.
+func (s *slackNotifier) handleBlockAction(ctx context.Context, action *slack.BlockAction) error {
+	project, buildID, err := parseBuildActionValue(action.Value)
+	if err != nil {
+		return err
+	}
+
+	switch action.ActionID {
+	case retryBuildActionID:
+		return s.cbClient.RetryBuild(ctx, project, buildID)
+	case cancelBuildActionID:
+		return s.cbClient.CancelBuild(ctx, project, buildID)
+	case approveBuildActionID:
+		return s.cbClient.ApproveBuild(ctx, project, buildID)
+	default:
+		return fmt.Errorf("unrecognized build action ID %q", action.ActionID)
+	}
+}
+
+// parseBuildActionValue splits a button Value of the form
+// "<project_id>/<build_id>" as emitted by a template's button blocks.
+func parseBuildActionValue(value string) (project, buildID string, err error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("button value %q is not in \"<project_id>/<build_id>\" form", value)
+	}
+	return parts[0], parts[1], nil
+}
+
+// isFailedStatus reports whether status is one that a log tail is worth
+// fetching for.
+func isFailedStatus(status cbpb.Build_Status) bool {
+	switch status {
+	case cbpb.Build_FAILURE, cbpb.Build_INTERNAL_ERROR, cbpb.Build_TIMEOUT:
+		return true
+	default:
+		return false
+	}
+}
+
+// fetchLogTail returns the last s.logTailLines lines of build's log from
+// Cloud Logging, in chronological order, truncated to maxBlockTextLen
+// characters so it always fits in a single Slack text block.
+func (s *slackNotifier) fetchLogTail(ctx context.Context, build *cbpb.Build) (string, error) {
+	fetcher, err := s.getLogTailFetcher(ctx, build.ProjectId)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Cloud Logging client: %w", err)
+	}
+
+	it := fetcher.FetchEntries(ctx, build.ProjectId, build.Id)
+
+	var lines []string
+	for len(lines) < s.logTailLines {
+		entry, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read log entries: %w", err)
+		}
+		lines = append(lines, fmt.Sprintf("%v", entry.Payload))
+	}
+
+	// Entries came back newest-first; reverse to chronological order.
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return truncate(strings.Join(lines, "\n"), maxBlockTextLen), nil
+}
+
+// getLogTailFetcher returns a cached logTailFetcher for project, creating
+// one if necessary. A logadmin.Client (and so the cloudLoggingFetcher
+// wrapping it) is bound to a single GCP project.
+func (s *slackNotifier) getLogTailFetcher(ctx context.Context, project string) (logTailFetcher, error) {
+	s.logFetchersMu.Lock()
+	defer s.logFetchersMu.Unlock()
+
+	if f, ok := s.logFetchers[project]; ok {
+		return f, nil
+	}
+	client, err := logadmin.NewClient(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	f := &cloudLoggingFetcher{client: client}
+	s.logFetchers[project] = f
+	return f, nil
+}
+
+// truncate shortens s to at most n characters, appending an ellipsis marker
+// when it does so, to stay under Slack's ~3000-char text block limit.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "...(truncated)"
+}
+
+// parseIdentityParam parses params[name] as a Go template, returning nil if
+// the param is unset or empty.
+func parseIdentityParam(params map[string]string, name string) (*template.Template, error) {
+	v, ok := params[name]
+	if !ok || v == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(name + "_template").Parse(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
 func (s *slackNotifier) SendNotification(ctx context.Context, build *cbpb.Build) error {
 
 	if !s.filter.Apply(ctx, build) {
@@ -118,18 +691,103 @@ func (s *slackNotifier) SendNotification(ctx context.Context, build *cbpb.Build)
 		return fmt.Errorf("failed to resolve bindings: %w", err)
 	}
 
+	if s.logTailLines > 0 && isFailedStatus(build.Status) {
+		logTail, err := s.fetchLogTail(ctx, build)
+		if err != nil {
+			// The log tail is a nice-to-have; don't fail the notification
+			// over it, just send the message without it.
+			log.Errorf("failed to fetch log tail for Build %q: %v", build.Id, err)
+		} else {
+			bindings["LogTail"] = logTail
+		}
+	}
+
 	s.tmplView = &notifiers.TemplateView{
 		Build:  &notifiers.BuildView{Build: build},
 		Params: bindings,
 	}
 
+	if s.rawBody {
+		var buf bytes.Buffer
+		if err := s.tmpl.Execute(&buf, s.tmplView); err != nil {
+			return fmt.Errorf("failed to execute template: %w", err)
+		}
+		return s.httpNotifier.Send(ctx, buf.Bytes())
+	}
+
 	msg, err := s.writeMessage()
 
 	if err != nil {
 		return fmt.Errorf("failed to write Slack message: %w", err)
 	}
 
-	return slack.PostWebhook(s.webhookURL, msg)
+	if s.slackClient == nil {
+		return slack.PostWebhook(s.webhookURL, msg)
+	}
+
+	return s.sendViaBotToken(ctx, msg)
+}
+
+// sendViaBotToken posts (or updates, or threads) msg using the bot-token
+// client, which is required whenever thread grouping is configured since
+// incoming webhooks have no notion of a message timestamp to thread under.
+func (s *slackNotifier) sendViaBotToken(ctx context.Context, msg *slack.WebhookMessage) error {
+	opts := []slack.MsgOption{
+		slack.MsgOptionAttachments(msg.Attachments...),
+	}
+	if msg.Text != "" {
+		opts = append(opts, slack.MsgOptionText(msg.Text, false))
+	}
+	if msg.Username != "" {
+		opts = append(opts, slack.MsgOptionUsername(msg.Username))
+	}
+	if msg.IconEmoji != "" {
+		opts = append(opts, slack.MsgOptionIconEmoji(msg.IconEmoji))
+	}
+	if msg.IconURL != "" {
+		opts = append(opts, slack.MsgOptionIconURL(msg.IconURL))
+	}
+
+	var threadKey string
+	if s.threadKeyTmpl != nil {
+		var buf bytes.Buffer
+		if err := s.threadKeyTmpl.Execute(&buf, s.tmplView); err != nil {
+			return fmt.Errorf("failed to execute threadKey template: %w", err)
+		}
+		threadKey = buf.String()
+	}
+
+	if threadKey == "" {
+		_, _, err := s.slackClient.PostMessageContext(ctx, s.channel, opts...)
+		return err
+	}
+
+	// Hold the per-key lock across the whole get-post-store sequence so
+	// that two notifications for the same threadKey arriving close
+	// together (e.g. a build retry firing while the first notification is
+	// still in flight) can't both observe "no thread yet" and each post a
+	// new root message.
+	unlock := s.threads.Lock(threadKey)
+	defer unlock()
+
+	if ts, ok := s.threads.Get(threadKey); ok {
+		if s.updateInPlace {
+			_, _, _, err := s.slackClient.UpdateMessageContext(ctx, s.channel, ts, opts...)
+			return err
+		}
+		opts = append(opts, slack.MsgOptionTS(ts))
+	}
+
+	_, ts, err := s.slackClient.PostMessageContext(ctx, s.channel, opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.threads.Get(threadKey); !ok {
+		s.threads.Set(threadKey, ts)
+	}
+
+	return nil
 }
 
 func (s *slackNotifier) writeMessage() (*slack.WebhookMessage, error) {
@@ -141,10 +799,10 @@ func (s *slackNotifier) writeMessage() (*slack.WebhookMessage, error) {
 	}
 
 	var clr string
-	switch build.Status {
-	case cbpb.Build_SUCCESS:
+	switch {
+	case build.Status == cbpb.Build_SUCCESS:
 		clr = "#22bb33"
-	case cbpb.Build_FAILURE, cbpb.Build_INTERNAL_ERROR, cbpb.Build_TIMEOUT:
+	case isFailedStatus(build.Status):
 		clr = "#bb2124"
 	default:
 		clr = "#f0ad4e"
@@ -156,7 +814,11 @@ func (s *slackNotifier) writeMessage() (*slack.WebhookMessage, error) {
 	}
 	var blocks slack.Blocks
 
-	jsonBytes := buf.Bytes()
+	jsonBytes, username, iconEmoji, iconURL, err := extractIdentityOverrides(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract identity overrides from templating JSON: %w", err)
+	}
+
 	err = blocks.UnmarshalJSON(jsonBytes)
 	if err != nil {
 		// Log the problematic JSON for debugging (truncate if too long)
@@ -179,5 +841,139 @@ func (s *slackNotifier) writeMessage() (*slack.WebhookMessage, error) {
 		msg.Text = textBuf.String()
 	}
 
+	if username == "" {
+		username, err = s.renderIdentityTmpl(s.usernameTmpl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute username template: %w", err)
+		}
+	}
+	msg.Username = username
+
+	if iconEmoji == "" {
+		iconEmoji, err = s.renderIdentityTmpl(s.iconEmojiTmpl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute icon_emoji template: %w", err)
+		}
+	}
+	msg.IconEmoji = iconEmoji
+
+	if iconURL == "" {
+		iconURL, err = s.renderIdentityTmpl(s.iconURLTmpl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute icon_url template: %w", err)
+		}
+	}
+	msg.IconURL = iconURL
+
 	return msg, nil
 }
+
+func (s *slackNotifier) renderIdentityTmpl(tmpl *template.Template) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, s.tmplView); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// extractIdentityOverrides accepts either the legacy blockkit template output
+// (a bare JSON array of blocks) or an object of the form
+// {"username": "...", "icon_emoji": "...", "icon_url": "...", "blocks": [...]}.
+// It returns the blocks JSON (always an array, suitable for
+// slack.Blocks.UnmarshalJSON) along with any identity overrides found, which
+// are stripped out before the blocks are unmarshaled.
+func extractIdentityOverrides(raw []byte) (blocksJSON []byte, username, iconEmoji, iconURL string, err error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return raw, "", "", "", nil
+	}
+
+	var wrapper struct {
+		Username  string          `json:"username"`
+		IconEmoji string          `json:"icon_emoji"`
+		IconURL   string          `json:"icon_url"`
+		Blocks    json.RawMessage `json:"blocks"`
+	}
+	if err := json.Unmarshal(trimmed, &wrapper); err != nil {
+		return nil, "", "", "", err
+	}
+	if wrapper.Blocks == nil {
+		return nil, "", "", "", fmt.Errorf("templating JSON is an object but has no \"blocks\" field")
+	}
+
+	return wrapper.Blocks, wrapper.Username, wrapper.IconEmoji, wrapper.IconURL, nil
+}
+
+// commitAuthorEmailSubstitutionKey is the Cloud Build substitution a trigger
+// is expected to populate (e.g. via a custom substitution or a build step)
+// with the email address of the commit author, for use by
+// mentionByCommitAuthor.
+const commitAuthorEmailSubstitutionKey = "_COMMIT_AUTHOR_EMAIL"
+
+// shouldMention reports whether mentions are allowed to fire for the current
+// notification. By default this is restricted to FAILURE/TIMEOUT/
+// INTERNAL_ERROR builds so that passing builds never page anyone; a
+// mentionFilter CEL expression can override this.
+func (s *slackNotifier) shouldMention() bool {
+	build := s.tmplView.Build.Build
+	if s.mentionFilter != nil {
+		return s.mentionFilter.Apply(context.Background(), build)
+	}
+	return isFailedStatus(build.Status)
+}
+
+// mentionByEmail resolves email to a Slack "<@USERID>" mention string via
+// s.mentionResolver, which consults the static mentionsMap secret and falls
+// back to a live users.lookupByEmail call when a bot token is configured. It
+// returns "" if email is empty or cannot be resolved, so that it renders
+// safely even when the mapping is incomplete.
+func (s *slackNotifier) mentionByEmail(email string) string {
+	if email == "" || !s.shouldMention() {
+		return ""
+	}
+	id, ok, err := s.mentionResolver.Resolve(context.Background(), email)
+	if err != nil {
+		log.Warningf("failed to resolve Slack user for email %q: %v", email, err)
+		return ""
+	}
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("<@%s>", id)
+}
+
+// lookupMentionByEmail is the StaticMentionResolver fallback used when an
+// email isn't found in the static mentionsMap: a live Slack
+// users.lookupByEmail call, available whenever a bot token is configured.
+func (s *slackNotifier) lookupMentionByEmail(ctx context.Context, email string) (string, bool, error) {
+	if s.slackClient == nil {
+		return "", false, nil
+	}
+	user, err := s.slackClient.GetUserByEmailContext(ctx, email)
+	if err != nil {
+		return "", false, err
+	}
+	return user.ID, true, nil
+}
+
+// mentionByCommitAuthor resolves the build's commit author
+// (commitAuthorEmailSubstitutionKey) to a Slack mention.
+func (s *slackNotifier) mentionByCommitAuthor() string {
+	return s.mentionByEmail(s.tmplView.Build.Build.Substitutions[commitAuthorEmailSubstitutionKey])
+}
+
+// mentionChannelOnBranch returns "<!channel>" when the build's BRANCH_NAME
+// substitution matches branch, so that templates can reserve @channel for
+// e.g. failures on main.
+func (s *slackNotifier) mentionChannelOnBranch(branch string) string {
+	if !s.shouldMention() {
+		return ""
+	}
+	if s.tmplView.Build.Build.Substitutions["BRANCH_NAME"] != branch {
+		return ""
+	}
+	return "<!channel>"
+}